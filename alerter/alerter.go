@@ -0,0 +1,34 @@
+// The alerter package is responsible for receiving alert messages generated by
+// monitors and dispatching them via the appropriate alerter type such as Slack,
+// PagerDuty and so forth.
+package alerter
+
+// Message is produced by a monitor any time it transitions between states
+// (warning, critical, resolve), and also for session reports, flap
+// detection, escalations and staleness, and handed off on a
+// RootMonitorConfig's MessageChannel for an alerter driver to deliver.
+type Message struct {
+	Type        string            // "resolve", "warning", "critical", "session", "flapping", "stable", "escalate", "stale"
+	Key         []string          // Keys coming from the monitor config for Critical, Warning, Session or EscalationLevel alerters
+	Title       string            // Short description of the alert
+	Text        string            // In-depth description of the alert state
+	Source      string            // Origin of the alert
+	Description string            // Original check description so we can be verbose about what we are alerting on
+	Count       int               // How many check attempts were made
+	Contents    map[string]string // Set checker-specific data (ensuring alerters know how to use the data)
+
+	// Report is only set when Type is "session" - a batched rollup of
+	// everything that happened during a monitor's session window rather
+	// than a single transition.
+	Report *SessionReport
+}
+
+// SessionReport is the structured payload of a "session" Message: a
+// summary of every check that ran, and every state transition that
+// occurred, since the monitor's last session flush.
+type SessionReport struct {
+	ChecksRun    int            // how many checks ran during the session
+	ChecksFailed int            // how many of those checks failed
+	Transitions  []string       // eg. "ok->warning", in the order they occurred
+	Counts       map[string]int // how many checks ended in each status, eg. {"ok": 4, "warning": 1}
+}
@@ -0,0 +1,974 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/9corp/9volt/alerter"
+	"github.com/9corp/9volt/state"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// subscriberBuffer is how many messages a slow subscriber can fall behind
+// before we start dropping for it.
+const subscriberBuffer = 16
+
+// defaultHeartbeatTimeout bounds how long we'll wait on a dead-man service
+// when HeartbeatTimeout hasn't been configured.
+const defaultHeartbeatTimeout = 10 * time.Second
+
+// defaultFlapCooldown is used when a monitor has FlapThreshold/FlapWindow
+// set but no FlapCooldown: without this, a check that flaps once would
+// suppress its own alerting forever with no way out.
+const defaultFlapCooldown = 5 * time.Minute
+
+// States of a monitor
+const (
+	// OK when the alerts have resolved and everything is peachy
+	OK int = iota
+	// WARNING when the number of failed attempts passes the WarningThreshold
+	WARNING
+	// CRITICAL when the number of failed attempts passes the CriticalThreshold
+	CRITICAL
+)
+
+var (
+	okNextStates       = [2]int{WARNING, CRITICAL}
+	warningNextStates  = [2]int{CRITICAL, OK}
+	criticalNextStates = [2]int{WARNING, OK}
+	stateTransition    = [3][2]int{okNextStates, warningNextStates, criticalNextStates}
+)
+
+// Base monitor to embed into monitors that do real work
+type Base struct {
+	RMC         *RootMonitorConfig
+	Identifier  string
+	MonitorFunc func() error
+
+	attemptCount      int
+	criticalAlertSent bool
+	warningAlertSent  bool
+	currentState      int
+	resolveMessages   map[string]*alerter.Message
+
+	session *sessionAccumulator
+
+	flapping         bool
+	transitionTimes  []time.Time
+	lastTransitionAt time.Time
+
+	failureSince    time.Time
+	escalatedLevels map[int]bool
+
+	subMu       sync.Mutex
+	nextSubID   int
+	stateSubs   map[int]*stateSubscription
+	messageSubs map[int]*messageSubscription
+
+	watchdogMu           sync.Mutex
+	lastTickAt           time.Time
+	checkStartedAt       time.Time
+	stale                bool
+	staleResolveMessages map[string]*alerter.Message
+}
+
+// stateSubscription is one consumer registered via Base.Subscribe.
+type stateSubscription struct {
+	ch        chan *state.Message
+	filter    SubscriptionFilter
+	dropped   uint64
+	closeOnce sync.Once
+}
+
+func (s *stateSubscription) close() {
+	s.closeOnce.Do(func() { close(s.ch) })
+}
+
+// messageSubscription is one consumer registered via Base.SubscribeAlerts.
+type messageSubscription struct {
+	ch        chan *alerter.Message
+	filter    SubscriptionFilter
+	dropped   uint64
+	closeOnce sync.Once
+}
+
+func (s *messageSubscription) close() {
+	s.closeOnce.Do(func() { close(s.ch) })
+}
+
+// matchesState reports whether a state.Message satisfies this filter.
+func (f SubscriptionFilter) matchesState(msg *state.Message) bool {
+	if f.Status != "" && f.Status != msg.Status {
+		return false
+	}
+	if f.Check != "" && f.Check != msg.Check {
+		return false
+	}
+	return true
+}
+
+// matchesMessage reports whether an alerter.Message satisfies this filter.
+func (f SubscriptionFilter) matchesMessage(msg *alerter.Message) bool {
+	if f.Status != "" && f.Status != msg.Type {
+		return false
+	}
+	if f.Check != "" && f.Check != msg.Source {
+		return false
+	}
+	if f.AlerterName != "" {
+		found := false
+		for _, key := range msg.Key {
+			if key == f.AlerterName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Subscribe registers a new live consumer of this monitor's state.Messages.
+// The returned channel is buffered; a subscriber that falls behind has
+// messages dropped (counted, not blocked) rather than stalling the monitor.
+// Call the returned CancelFunc to unsubscribe; it's safe to call more than
+// once.
+func (b *Base) Subscribe(filter SubscriptionFilter) (<-chan *state.Message, CancelFunc) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	if b.stateSubs == nil {
+		b.stateSubs = make(map[int]*stateSubscription)
+	}
+
+	id := b.nextSubID
+	b.nextSubID++
+
+	sub := &stateSubscription{ch: make(chan *state.Message, subscriberBuffer), filter: filter}
+	b.stateSubs[id] = sub
+
+	return sub.ch, func() {
+		b.subMu.Lock()
+		delete(b.stateSubs, id)
+		b.subMu.Unlock()
+		sub.close()
+	}
+}
+
+// SubscribeAlerts registers a new live consumer of this monitor's
+// alerter.Messages. Semantics match Subscribe.
+func (b *Base) SubscribeAlerts(filter SubscriptionFilter) (<-chan *alerter.Message, CancelFunc) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	if b.messageSubs == nil {
+		b.messageSubs = make(map[int]*messageSubscription)
+	}
+
+	id := b.nextSubID
+	b.nextSubID++
+
+	sub := &messageSubscription{ch: make(chan *alerter.Message, subscriberBuffer), filter: filter}
+	b.messageSubs[id] = sub
+
+	return sub.ch, func() {
+		b.subMu.Lock()
+		delete(b.messageSubs, id)
+		b.subMu.Unlock()
+		sub.close()
+	}
+}
+
+// DroppedStateMessages returns how many state.Messages have been dropped
+// across all live Subscribe consumers because they fell behind, so a slow
+// subscriber can actually be noticed instead of silently losing updates.
+func (b *Base) DroppedStateMessages() uint64 {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	var total uint64
+	for _, sub := range b.stateSubs {
+		total += sub.dropped
+	}
+	return total
+}
+
+// DroppedAlertMessages is DroppedStateMessages for SubscribeAlerts consumers.
+func (b *Base) DroppedAlertMessages() uint64 {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	var total uint64
+	for _, sub := range b.messageSubs {
+		total += sub.dropped
+	}
+	return total
+}
+
+// closeSubscriptions shuts down every live subscription so Subscribe/
+// SubscribeAlerts consumers don't leak when the monitor stops.
+func (b *Base) closeSubscriptions() {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	for id, sub := range b.stateSubs {
+		sub.close()
+		delete(b.stateSubs, id)
+	}
+	for id, sub := range b.messageSubs {
+		sub.close()
+		delete(b.messageSubs, id)
+	}
+}
+
+// publishState sends a state.Message down RMC.StateChannel and fans it out
+// to any live subscribers whose filter matches.
+func (b *Base) publishState(msg *state.Message) {
+	b.RMC.StateChannel <- msg
+
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	for _, sub := range b.stateSubs {
+		if !sub.filter.matchesState(msg) {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+			sub.dropped++
+			b.RMC.Log.WithFields(log.Fields{"configName": b.RMC.ConfigName, "dropped": sub.dropped}).
+				Warn("State subscriber is falling behind, dropping message")
+		}
+	}
+}
+
+// publishMessage sends an alerter.Message down RMC.MessageChannel and fans
+// it out to any live subscribers whose filter matches.
+func (b *Base) publishMessage(msg *alerter.Message) {
+	b.RMC.MessageChannel <- msg
+
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	for _, sub := range b.messageSubs {
+		if !sub.filter.matchesMessage(msg) {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+			sub.dropped++
+			b.RMC.Log.WithFields(log.Fields{"configName": b.RMC.ConfigName, "dropped": sub.dropped}).
+				Warn("Alert subscriber is falling behind, dropping message")
+		}
+	}
+}
+
+// sessionAccumulator tallies up check results between session report
+// flushes for monitors that have at least one SessionAlerter configured.
+type sessionAccumulator struct {
+	start        time.Time
+	checksRun    int
+	checksFailed int
+	transitions  []string
+	counts       map[string]int
+}
+
+func newSessionAccumulator() *sessionAccumulator {
+	return &sessionAccumulator{
+		start:  time.Now(),
+		counts: make(map[string]int),
+	}
+}
+
+// sessionEnabled returns true if this monitor has been set up to batch
+// alerts for at least one alerter into a periodic session report.
+func (b *Base) sessionEnabled() bool {
+	return len(b.RMC.Config.SessionAlerter) > 0 && b.RMC.SessionTicker != nil
+}
+
+// withoutSessionAlerters strips out any alerter name that's opted into
+// session reporting, so per-event sendMessage calls don't also deliver a
+// one-off alert to it.
+func (b *Base) withoutSessionAlerters(alerters []string) []string {
+	if !b.sessionEnabled() {
+		return alerters
+	}
+
+	filtered := make([]string, 0, len(alerters))
+	for _, name := range alerters {
+		isSessionAlerter := false
+		for _, sessionName := range b.RMC.Config.SessionAlerter {
+			if name == sessionName {
+				isSessionAlerter = true
+				break
+			}
+		}
+		if !isSessionAlerter {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+// flapEnabled returns true if this monitor has been configured to detect
+// flapping (rapid, repeated state transitions).
+func (b *Base) flapEnabled() bool {
+	return b.RMC.Config.FlapThreshold > 0 && b.RMC.Config.FlapWindow > 0
+}
+
+// flapAlerters is who gets told about entering/leaving the flapping state:
+// whichever alerters would normally hear about a warning or critical.
+func (b *Base) flapAlerters() []string {
+	seen := make(map[string]bool)
+	alerters := make([]string, 0)
+
+	for _, list := range [][]string{b.RMC.Config.WarningAlerter, b.RMC.Config.CriticalAlerter} {
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				alerters = append(alerters, name)
+			}
+		}
+	}
+
+	return alerters
+}
+
+// recordTransition tallies this transition against the flap window and
+// returns true if the check should be considered flapping as a result.
+// Entering the flapping state here emits a single "flapping" message.
+func (b *Base) recordTransition(now time.Time) bool {
+	if !b.flapEnabled() {
+		return false
+	}
+
+	b.lastTransitionAt = now
+	b.transitionTimes = append(b.transitionTimes, now)
+
+	cutoff := now.Add(-b.RMC.Config.FlapWindow)
+	pruned := b.transitionTimes[:0]
+	for _, t := range b.transitionTimes {
+		if t.After(cutoff) {
+			pruned = append(pruned, t)
+		}
+	}
+	b.transitionTimes = pruned
+
+	if !b.flapping && len(b.transitionTimes) >= b.RMC.Config.FlapThreshold {
+		b.flapping = true
+		b.sendFlapMessage("flapping")
+	}
+
+	return b.flapping
+}
+
+// flapCooldown is FlapCooldown, or defaultFlapCooldown if unset - flapping
+// must never become a permanent, silent alert blackhole just because an
+// operator configured FlapThreshold/FlapWindow and left this one out.
+func (b *Base) flapCooldown() time.Duration {
+	if b.RMC.Config.FlapCooldown > 0 {
+		return b.RMC.Config.FlapCooldown
+	}
+	return defaultFlapCooldown
+}
+
+// checkFlapCooldown exits the flapping state (emitting a single "stable"
+// message) once the cooldown has passed without a further transition, and
+// flushes any resolve messages that piled up while alerts were suppressed.
+func (b *Base) checkFlapCooldown() {
+	if !b.flapping {
+		return
+	}
+
+	if time.Since(b.lastTransitionAt) < b.flapCooldown() {
+		return
+	}
+
+	b.flapping = false
+	b.sendFlapMessage("stable")
+
+	if b.currentState == OK {
+		b.flushResolveMessages()
+	}
+}
+
+func (b *Base) sendFlapMessage(msgType string) {
+	text := fmt.Sprintf("Check '%v' is flapping: %v transitions within %v", b.RMC.ConfigName, len(b.transitionTimes), b.RMC.Config.FlapWindow)
+	if msgType == "stable" {
+		text = fmt.Sprintf("Check '%v' has stabilized after %v with no further transitions", b.RMC.ConfigName, b.flapCooldown())
+	}
+
+	b.publishMessage(&alerter.Message{
+		Type:        msgType,
+		Key:         b.flapAlerters(),
+		Title:       fmt.Sprintf("%v check '%v' %v", strings.ToUpper(b.Identify()), b.RMC.ConfigName, msgType),
+		Text:        text,
+		Source:      b.RMC.ConfigName,
+		Description: b.RMC.Config.Description,
+		Contents: map[string]string{
+			"FlapThreshold": fmt.Sprint(b.RMC.Config.FlapThreshold),
+			"FlapWindow":    b.RMC.Config.FlapWindow.String(),
+		},
+	})
+}
+
+// flushResolveMessages sends out (and clears) any resolve messages that
+// are still pending - used once flapping suppression lifts.
+func (b *Base) flushResolveMessages() {
+	for alert, resolve := range b.resolveMessages {
+		b.publishMessage(resolve)
+		delete(b.resolveMessages, alert)
+	}
+}
+
+// watchdogEnabled returns true if this monitor has been configured to
+// watch its own liveness (as opposed to the check result itself).
+func (b *Base) watchdogEnabled() bool {
+	return b.RMC.Config.MaxCheckDuration > 0 || b.RMC.Config.MaxTickerSilence > 0
+}
+
+// watchdogInterval is how often the watchdog polls for staleness - a
+// quarter of the tightest configured threshold, so we notice in good time
+// without busy-looping.
+func (b *Base) watchdogInterval() time.Duration {
+	tightest := b.RMC.Config.MaxCheckDuration
+	if b.RMC.Config.MaxTickerSilence > 0 && (tightest == 0 || b.RMC.Config.MaxTickerSilence < tightest) {
+		tightest = b.RMC.Config.MaxTickerSilence
+	}
+
+	interval := tightest / 4
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return interval
+}
+
+// runWatchdog polls for staleness until done is closed; it's started as
+// its own goroutine from Run() since MonitorFunc hanging must not stop us
+// from noticing.
+func (b *Base) runWatchdog(done <-chan struct{}) {
+	ticker := time.NewTicker(b.watchdogInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.checkStaleness()
+		case <-done:
+			return
+		}
+	}
+}
+
+func (b *Base) markTick() {
+	b.watchdogMu.Lock()
+	b.lastTickAt = time.Now()
+	b.watchdogMu.Unlock()
+}
+
+func (b *Base) markCheckStart() {
+	b.watchdogMu.Lock()
+	b.checkStartedAt = time.Now()
+	b.watchdogMu.Unlock()
+}
+
+func (b *Base) markCheckDone() {
+	b.watchdogMu.Lock()
+	b.checkStartedAt = time.Time{}
+	b.watchdogMu.Unlock()
+}
+
+// checkStaleness is run from the watchdog goroutine; it's the only place
+// that flips b.stale, so sendStaleMessage/resolveStaleMessage only ever
+// fire once per transition.
+func (b *Base) checkStaleness() {
+	cfg := b.RMC.Config
+	now := time.Now()
+
+	b.watchdogMu.Lock()
+	reason := ""
+	if cfg.MaxCheckDuration > 0 && !b.checkStartedAt.IsZero() && now.Sub(b.checkStartedAt) >= cfg.MaxCheckDuration {
+		reason = fmt.Sprintf("MonitorFunc has not returned in over %v", cfg.MaxCheckDuration)
+	} else if cfg.MaxTickerSilence > 0 && !b.lastTickAt.IsZero() && now.Sub(b.lastTickAt) >= cfg.MaxTickerSilence {
+		reason = fmt.Sprintf("ticker has not advanced in over %v", cfg.MaxTickerSilence)
+	}
+
+	wasStale := b.stale
+	b.stale = reason != ""
+	b.watchdogMu.Unlock()
+
+	if b.stale && !wasStale {
+		b.sendStaleMessage(reason)
+	} else if !b.stale && wasStale {
+		b.resolveStaleMessage()
+	}
+}
+
+func (b *Base) sendStaleMessage(reason string) {
+	alerters := b.flapAlerters()
+
+	msg := &alerter.Message{
+		Type:        "stale",
+		Key:         alerters,
+		Title:       fmt.Sprintf("%v check '%v' is stale", strings.ToUpper(b.Identify()), b.RMC.ConfigName),
+		Text:        fmt.Sprintf("Check appears stalled: %v", reason),
+		Source:      b.RMC.ConfigName,
+		Description: b.RMC.Config.Description,
+	}
+
+	b.publishMessage(msg)
+
+	b.watchdogMu.Lock()
+	if b.staleResolveMessages == nil {
+		b.staleResolveMessages = make(map[string]*alerter.Message)
+	}
+	for _, alert := range alerters {
+		if _, exists := b.staleResolveMessages[alert]; !exists {
+			resolveMsg := &alerter.Message{}
+			*resolveMsg = *msg
+
+			resolveMsg.Type = "resolve"
+			resolveMsg.Key = []string{alert}
+			resolveMsg.Title = fmt.Sprintf("%v check '%v' recovered", strings.ToUpper(b.Identify()), b.RMC.ConfigName)
+			resolveMsg.Text = "Check has recovered from stale"
+
+			b.staleResolveMessages[alert] = resolveMsg
+		}
+	}
+	b.watchdogMu.Unlock()
+}
+
+// resolveStaleMessage sends out (and clears) whatever stale resolves are
+// still pending, once the watchdog sees progress resume.
+func (b *Base) resolveStaleMessage() {
+	b.watchdogMu.Lock()
+	pending := b.staleResolveMessages
+	b.staleResolveMessages = nil
+	b.watchdogMu.Unlock()
+
+	for _, resolve := range pending {
+		b.publishMessage(resolve)
+	}
+}
+
+// heartbeatEnabled returns true if this monitor should push liveness pings
+// to an external dead-man service.
+func (b *Base) heartbeatEnabled() bool {
+	return b.RMC.Config.HeartbeatURL != ""
+}
+
+// heartbeatStates returns which post-check states should be pinged as a
+// heartbeat success/fail, defaulting to just "ok" if unconfigured.
+func (b *Base) heartbeatStates() []string {
+	if len(b.RMC.Config.HeartbeatOnStates) > 0 {
+		return b.RMC.Config.HeartbeatOnStates
+	}
+	return []string{"ok"}
+}
+
+func (b *Base) heartbeatEligible(status string) bool {
+	for _, s := range b.heartbeatStates() {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// sendHeartbeat pushes a liveness ping to HeartbeatURL+path. Failures are
+// logged but never propagate, so an unreachable dead-man service does not
+// affect StateChannel output. The request is made inline on the main loop:
+// an unresponsive endpoint holds up the tick for up to HeartbeatTimeout
+// (defaultHeartbeatTimeout when unset).
+func (b *Base) sendHeartbeat(path string) {
+	if !b.heartbeatEnabled() {
+		return
+	}
+
+	timeout := b.RMC.Config.HeartbeatTimeout
+	if timeout <= 0 {
+		timeout = defaultHeartbeatTimeout
+	}
+
+	client := &http.Client{Timeout: timeout}
+
+	resp, err := client.Post(b.RMC.Config.HeartbeatURL+path, "text/plain", nil)
+	if err != nil {
+		b.RMC.Log.WithField("configName", b.RMC.ConfigName).Warnf("Unable to reach heartbeat endpoint %v: %v", path, err.Error())
+		return
+	}
+	resp.Body.Close()
+}
+
+// sendHeartbeatFinish pings /success or /fail?exit=N once a check has
+// completed, gated by HeartbeatOnStates. Both the gate and the success/fail
+// branch key off b.currentState - the debounced alert state - rather than
+// this tick's raw monitorErr, so a transient failure that hasn't yet crossed
+// WarningThreshold/CriticalThreshold still pings /success while the check is
+// still considered "ok".
+func (b *Base) sendHeartbeatFinish(monitorErr error) {
+	var status = [3]string{"ok", "warning", "critical"}
+
+	if !b.heartbeatEligible(status[b.currentState]) {
+		return
+	}
+
+	if b.currentState == OK {
+		b.sendHeartbeat("/success")
+		return
+	}
+
+	b.sendHeartbeat(fmt.Sprintf("/fail?exit=%d", b.currentState))
+}
+
+// Stop the monitor
+func (b *Base) Stop() {
+	b.closeSubscriptions()
+	b.RMC.StopChannel <- true
+}
+
+// Identify the monitor by a string
+func (b *Base) Identify() string {
+	return b.Identifier
+}
+
+// Run the check on a given interval -> evaluate response via b.handle()
+func (b *Base) Run() error {
+	llog := b.RMC.Log.WithFields(log.Fields{"monitorName": b.RMC.Name, "method": b.RMC.Name})
+
+	llog.Debug("Starting work")
+
+	defer b.RMC.Ticker.Stop()
+
+	b.resolveMessages = make(map[string]*alerter.Message)
+
+	var sessionChan <-chan time.Time
+	if b.sessionEnabled() {
+		b.session = newSessionAccumulator()
+		sessionChan = b.RMC.SessionTicker.C
+	}
+
+	watchdogDone := make(chan struct{})
+	defer close(watchdogDone)
+	if b.watchdogEnabled() {
+		b.markTick()
+		go b.runWatchdog(watchdogDone)
+	}
+
+Mainloop:
+	for {
+		select {
+		case <-b.RMC.Ticker.C:
+			llog.Debug("Monitor tick")
+			b.markTick()
+			b.sendHeartbeat("/start")
+			b.markCheckStart()
+			monitorErr := b.MonitorFunc()
+			b.markCheckDone()
+			if err := b.handle(monitorErr); err != nil {
+				log.Errorf("Unable to complete check handler: %v", err.Error())
+			}
+			b.sendHeartbeatFinish(monitorErr)
+		case <-sessionChan:
+			llog.Debug("Session report tick")
+			b.flushSession()
+		case <-b.RMC.StopChannel:
+			llog.Debug("Asked to shutdown")
+			break Mainloop
+		}
+	}
+
+	llog.Debug("Goroutine exiting...")
+	return nil
+}
+
+// Handle triggering/resolving alerts based on check results
+func (b *Base) handle(monitorErr error) error {
+	var err error
+	// Update state every run
+	defer b.updateState(monitorErr)
+
+	// Independent of whether this check causes a transition, see if we've
+	// gone quiet long enough to leave the flapping state.
+	b.checkFlapCooldown()
+
+	if b.session != nil {
+		b.session.checksRun++
+		if monitorErr != nil {
+			b.session.checksFailed++
+		}
+	}
+
+	// No problems, reset counter
+	if monitorErr == nil {
+		err = b.transitionStateTo(OK, "")
+		b.attemptCount = 0
+		b.failureSince = time.Time{}
+		b.escalatedLevels = nil
+		return nil
+	}
+
+	// Increase attempt count
+	b.attemptCount++
+	if b.attemptCount == 1 {
+		b.failureSince = time.Now()
+	}
+	if b.attemptCount >= b.RMC.Config.CriticalThreshold {
+		err = b.transitionStateTo(CRITICAL, monitorErr.Error())
+	} else if b.attemptCount >= b.RMC.Config.WarningThreshold {
+		err = b.transitionStateTo(WARNING, monitorErr.Error())
+	}
+
+	b.checkEscalations(monitorErr.Error())
+
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkEscalations fires any not-yet-fired EscalationLevel whose threshold
+// has now been crossed, in order. Levels stay fired (and won't re-alert)
+// until the check resolves.
+func (b *Base) checkEscalations(errorDetails string) {
+	for idx, level := range b.RMC.Config.EscalationLevels {
+		if b.escalatedLevels[idx] {
+			continue
+		}
+
+		byFailures := level.AfterConsecutiveFailures > 0 && b.attemptCount >= level.AfterConsecutiveFailures
+		byDuration := level.AfterDuration > 0 && !b.failureSince.IsZero() && time.Since(b.failureSince) >= level.AfterDuration
+
+		if byFailures || byDuration {
+			b.fireEscalation(idx, level, errorDetails)
+		}
+	}
+}
+
+func (b *Base) fireEscalation(idx int, level EscalationLevel, errorDetails string) {
+	msg := &alerter.Message{
+		Type:        "escalate",
+		Key:         level.Alerters,
+		Title:       fmt.Sprintf("%v check '%v' escalated to level %d", strings.ToUpper(b.Identify()), b.RMC.ConfigName, idx+1),
+		Text:        fmt.Sprintf("Check has been failing for %v consecutive checks, escalating to level %d", b.attemptCount, idx+1),
+		Count:       b.attemptCount,
+		Source:      b.RMC.ConfigName,
+		Description: b.RMC.Config.Description,
+		Contents: map[string]string{
+			"ErrorDetails": errorDetails,
+		},
+	}
+
+	b.publishMessage(msg)
+
+	// Get resolve functions ready, same dedup-by-alerter pattern as
+	// sendMessage - an operator listed at multiple escalation levels (or
+	// also in WarningAlerter/CriticalAlerter) only gets one resolve.
+	for _, alert := range level.Alerters {
+		if _, exists := b.resolveMessages[alert]; !exists {
+			resolveMsg := &alerter.Message{}
+			*resolveMsg = *msg
+
+			resolveMsg.Type = "resolve"
+			resolveMsg.Key = []string{alert}
+
+			b.resolveMessages[alert] = resolveMsg
+		}
+	}
+
+	if b.escalatedLevels == nil {
+		b.escalatedLevels = make(map[int]bool)
+	}
+	b.escalatedLevels[idx] = true
+}
+
+// Construct a new alert message, send down the message channel and update alert state
+func (b *Base) sendMessage(curState int, titleMessage, alertMessage, errorDetails string) error {
+	var alertType = [3]string{"resolve", "warning", "critical"}
+	var configuredKey = [3][]string{{}, b.RMC.Config.WarningAlerter, b.RMC.Config.CriticalAlerter}
+	var alertKey = [3][]string{
+		{},
+		b.withoutSessionAlerters(b.RMC.Config.WarningAlerter),
+		b.withoutSessionAlerters(b.RMC.Config.CriticalAlerter),
+	}
+
+	// Every alerter configured for this tier opted into session reporting
+	// instead - nothing left to send a per-event alert to.
+	if len(configuredKey[curState]) > 0 && len(alertKey[curState]) == 0 {
+		return nil
+	}
+
+	log.Debugf("%v-%v: (%v) %v", b.Identifier, b.RMC.GID, b.RMC.Name, alertMessage)
+
+	msg := &alerter.Message{
+		Type:        alertType[curState],
+		Key:         alertKey[curState],
+		Title:       titleMessage,
+		Text:        alertMessage,
+		Count:       b.attemptCount,
+		Source:      b.RMC.ConfigName, // should be unique per check (used as incident key for PD)
+		Description: b.RMC.Config.Description,
+
+		// Let's set some additional (potentially) useful info in the message
+		Contents: map[string]string{
+			"WarningThreshold":  fmt.Sprint(b.RMC.Config.WarningThreshold),
+			"CriticalThreshold": fmt.Sprint(b.RMC.Config.CriticalThreshold),
+			"ErrorDetails":      errorDetails,
+		},
+	}
+
+	// Send the message
+	b.publishMessage(msg)
+
+	b.RMC.Log.WithFields(log.Fields{
+		"configName": b.RMC.ConfigName,
+		"msgType":    msg.Type,
+		"name":       b.RMC.Name,
+	}).Debug("Successfully sent message")
+
+	// Get resolve functions ready
+	for _, alert := range alertKey[curState] {
+		// If we don't have a resolution message for the check then let's add it
+		if _, exists := b.resolveMessages[alert]; !exists {
+			resolvMsg := &alerter.Message{}
+			// Copy the previous message
+			*resolvMsg = *msg
+
+			resolvMsg.Type = alertType[OK]
+			resolvMsg.Key = []string{alert}
+
+			b.resolveMessages[alert] = resolvMsg
+		}
+	}
+
+	return nil
+}
+
+// Construct a state message and send it down the state channel
+//
+// `updateState()` is intended to be ran *every* time `handle()` is ran; raw config
+// is included for convenience.
+func (b *Base) updateState(monitorErr error) error {
+	var status = [3]string{"ok", "warning", "critical"}
+	jsonConfig, err := json.Marshal(b.RMC.Config)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Unable to marshal monitor config to JSON: %v", err.Error())
+		jsonConfig = []byte(fmt.Sprintf(`{"error": "%v"}`, errorMessage))
+		log.Error(errorMessage)
+	}
+
+	// If no error is set, set it to N/A for display purposes
+	if monitorErr == nil {
+		monitorErr = errors.New("N/A")
+	}
+
+	b.publishState(&state.Message{
+		Check:   b.RMC.ConfigName,
+		Owner:   b.RMC.MemberID,
+		Status:  status[b.currentState],
+		Count:   b.attemptCount,
+		Message: monitorErr.Error(),
+		Date:    time.Now(),
+		Config:  jsonConfig,
+	})
+
+	if b.session != nil {
+		b.session.counts[status[b.currentState]]++
+	}
+
+	b.RMC.Log.WithField("configName", b.RMC.ConfigName).Debug("Successfully sent state message")
+
+	return nil
+}
+
+func (b *Base) stateEvent(curState int, monitorErr string) {
+	var stateStr = [3]string{"", "warning", "critical"}
+	if curState == OK {
+		for alert, resolve := range b.resolveMessages {
+			// If we've resolved then let's send all those resolve messages
+			resolve.Text = fmt.Sprintf("Check has recovered from %s after %v checks", stateStr[b.currentState], b.attemptCount)
+
+			// Send the message
+			b.publishMessage(resolve)
+
+			// Delete this call from the map
+			delete(b.resolveMessages, alert)
+		}
+		return
+	}
+	titleMessage := fmt.Sprintf("%v check '%v' failure", strings.ToUpper(b.Identify()), b.RMC.ConfigName)
+	alertMessage := fmt.Sprintf("Check has entered into %s state after %v checks", stateStr[curState], b.attemptCount)
+	b.sendMessage(curState, titleMessage, alertMessage, monitorErr)
+}
+
+func (b *Base) transitionStateTo(state int, monitorErr string) error {
+	// If the state is the same, then we don't want to trigger the events
+	if state == b.currentState {
+		return nil
+	}
+
+	for _, potentialNextState := range stateTransition[b.currentState] {
+		// Is the state I want to transition to a valid next state
+		if potentialNextState == state {
+			if b.session != nil {
+				var stateStr = [3]string{"ok", "warning", "critical"}
+				b.session.transitions = append(b.session.transitions, fmt.Sprintf("%s->%s", stateStr[b.currentState], stateStr[state]))
+			}
+
+			// While flapping, suppress the alert this transition would
+			// otherwise send; checkFlapCooldown flushes pending resolves
+			// once the check settles down in OK. Suppressed warning/critical
+			// alerts are dropped, not replayed.
+			if !b.recordTransition(time.Now()) {
+				b.stateEvent(state, monitorErr)
+			}
+			b.currentState = state
+			return nil
+		}
+	}
+	return fmt.Errorf("Failed to transition from state %d to %d", b.currentState, state)
+}
+
+// setStateTransition is really only meant to be used in tests
+func setStateTransition(idx int, transition [2]int) {
+	stateTransition[idx] = transition
+}
+
+// flushSession sends a single rolled-up alerter.Message to every
+// SessionAlerter describing everything that's happened since the last
+// flush, then resets the accumulator. It's a no-op if no checks ran
+// during the window.
+func (b *Base) flushSession() {
+	if b.session == nil || b.session.checksRun == 0 {
+		return
+	}
+
+	s := b.session
+
+	b.publishMessage(&alerter.Message{
+		Type:        "session",
+		Key:         b.RMC.Config.SessionAlerter,
+		Title:       fmt.Sprintf("%v check '%v' session report", strings.ToUpper(b.Identify()), b.RMC.ConfigName),
+		Text:        fmt.Sprintf("%v checks ran, %v failed since %v", s.checksRun, s.checksFailed, s.start.Format(time.RFC3339)),
+		Source:      b.RMC.ConfigName,
+		Description: b.RMC.Config.Description,
+		Report: &alerter.SessionReport{
+			ChecksRun:    s.checksRun,
+			ChecksFailed: s.checksFailed,
+			Transitions:  s.transitions,
+			Counts:       s.counts,
+		},
+	})
+
+	b.session = newSessionAccumulator()
+}
@@ -2,6 +2,8 @@ package monitor
 
 import (
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -326,5 +328,488 @@ var _ = Describe("base_monitor", func() {
 				}
 			})
 		})
+
+		Context("flapping", func() {
+			BeforeEach(func() {
+				monitor.RMC.Config.FlapThreshold = 2
+				monitor.RMC.Config.FlapWindow = time.Minute
+				monitor.RMC.Config.FlapCooldown = time.Minute
+
+				monitor.resolveMessages = make(map[string]*alerter.Message)
+			})
+
+			It("suppresses alerts once the flap threshold is reached", func() {
+				// OK -> CRITICAL is the first transition, still under
+				// FlapThreshold, so it alerts normally.
+				Expect(monitor.transitionStateTo(CRITICAL, "failed check")).To(BeNil())
+				var flapAlert *alerter.Message
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("critical"))
+
+				// CRITICAL -> OK is the second transition within the
+				// window, tripping FlapThreshold - its own alert (the
+				// resolve) is replaced by a single "flapping" message.
+				Expect(monitor.transitionStateTo(OK, "")).To(BeNil())
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("flapping"))
+				Expect(monitor.flapping).To(BeTrue())
+
+				// Further toggling while still flapping is fully suppressed.
+				Expect(monitor.transitionStateTo(CRITICAL, "failed check")).To(BeNil())
+				Consistently(monitor.RMC.MessageChannel).ShouldNot(Receive())
+			})
+
+			It("resumes normal alerting once FlapCooldown has passed without a transition", func() {
+				Expect(monitor.transitionStateTo(CRITICAL, "failed check")).To(BeNil())
+				var flapAlert *alerter.Message
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("critical"))
+
+				Expect(monitor.transitionStateTo(OK, "")).To(BeNil())
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("flapping"))
+				Expect(monitor.flapping).To(BeTrue())
+
+				// Simulate the check having gone quiet for longer than
+				// FlapCooldown: back-date the last transition and clear out
+				// the transition history the window would otherwise have
+				// aged out on its own.
+				monitor.lastTransitionAt = time.Now().Add(-2 * time.Minute)
+				monitor.transitionTimes = nil
+				monitor.checkFlapCooldown()
+				Expect(monitor.flapping).To(BeFalse())
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("stable"))
+
+				// The resolve that was held back while flapping is flushed
+				// once things settle down.
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("resolve"))
+
+				// Normal alerting should resume for a fresh transition.
+				Expect(monitor.transitionStateTo(CRITICAL, "failed check")).To(BeNil())
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("critical"))
+			})
+
+			It("still delivers the resolve once the check recovers during cooldown exit", func() {
+				Expect(monitor.transitionStateTo(CRITICAL, "failed check")).To(BeNil())
+				var flapAlert *alerter.Message
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("critical"))
+
+				Expect(monitor.transitionStateTo(OK, "")).To(BeNil())
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("flapping"))
+
+				// Trips CRITICAL again while flapping - fully suppressed,
+				// but it leaves a pending resolve message behind once it
+				// recovers.
+				Expect(monitor.transitionStateTo(CRITICAL, "failed check")).To(BeNil())
+				Consistently(monitor.RMC.MessageChannel).ShouldNot(Receive())
+				Expect(monitor.transitionStateTo(OK, "")).To(BeNil())
+				Consistently(monitor.RMC.MessageChannel).ShouldNot(Receive())
+
+				monitor.lastTransitionAt = time.Now().Add(-2 * time.Minute)
+				monitor.transitionTimes = nil
+				monitor.checkFlapCooldown()
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("stable"))
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("resolve"))
+			})
+
+			It("still lifts suppression via the default cooldown when FlapCooldown is left unset", func() {
+				monitor.RMC.Config.FlapCooldown = 0
+
+				Expect(monitor.transitionStateTo(CRITICAL, "failed check")).To(BeNil())
+				var flapAlert *alerter.Message
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("critical"))
+
+				Expect(monitor.transitionStateTo(OK, "")).To(BeNil())
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("flapping"))
+				Expect(monitor.flapping).To(BeTrue())
+
+				// Without an explicit FlapCooldown, a transition-free gap
+				// shorter than defaultFlapCooldown must NOT lift suppression -
+				// otherwise the fallback wouldn't even be doing anything.
+				monitor.lastTransitionAt = time.Now().Add(-time.Minute)
+				monitor.transitionTimes = nil
+				monitor.checkFlapCooldown()
+				Expect(monitor.flapping).To(BeTrue())
+				Consistently(monitor.RMC.MessageChannel).ShouldNot(Receive())
+
+				// Once it's gone longer than defaultFlapCooldown, suppression
+				// lifts on its own - it must never become permanent just
+				// because FlapCooldown was left at its zero value.
+				monitor.lastTransitionAt = time.Now().Add(-2 * defaultFlapCooldown)
+				monitor.checkFlapCooldown()
+				Expect(monitor.flapping).To(BeFalse())
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("stable"))
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&flapAlert))
+				Expect(flapAlert.Type).To(Equal("resolve"))
+			})
+		})
+
+		Context("watchdog", func() {
+			BeforeEach(func() {
+				monitor.RMC.Config.MaxCheckDuration = 20 * time.Millisecond
+				monitor.resolveMessages = make(map[string]*alerter.Message)
+			})
+
+			It("raises a stale alert when MonitorFunc hangs, without blocking the test", func() {
+				hang := make(chan struct{})
+				monitor.MonitorFunc = func() error {
+					<-hang // deliberately never closed - simulates a permanently stuck check
+					return nil
+				}
+
+				tickerChan <- time.Now()
+				go monitor.Run()
+
+				var received *alerter.Message
+				Eventually(monitor.RMC.MessageChannel, "2s", "10ms").Should(Receive(&received))
+				Expect(received.Type).To(Equal("stale"))
+				Expect(received.Text).To(ContainSubstring("MonitorFunc has not returned"))
+			})
+
+			It("emits a recovery resolve, not another stale-sounding message, once progress resumes", func() {
+				monitor.checkStartedAt = time.Now().Add(-time.Minute)
+				monitor.checkStaleness()
+
+				var staleAlert *alerter.Message
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&staleAlert))
+				Expect(staleAlert.Type).To(Equal("stale"))
+
+				monitor.checkStartedAt = time.Time{}
+				monitor.checkStaleness()
+
+				var resolveAlert *alerter.Message
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&resolveAlert))
+				Expect(resolveAlert.Type).To(Equal("resolve"))
+				Expect(resolveAlert.Text).To(ContainSubstring("recovered"))
+				Expect(resolveAlert.Text).ToNot(ContainSubstring("stalled"))
+			})
+		})
+
+		Context("subscriptions", func() {
+			It("fans out state messages matching the filter to a subscriber", func() {
+				stateCh, cancel := monitor.Subscribe(SubscriptionFilter{Status: "ok"})
+				defer cancel()
+
+				// Stop on the *second* tick so the first tick's message is
+				// published (and landed in the subscriber's buffer) before
+				// Stop() tears the subscription down.
+				loops := 0
+				monitor.MonitorFunc = func() error {
+					loops++
+					if loops >= 2 {
+						monitor.Stop()
+					}
+					return nil
+				}
+				tickerChan <- time.Now()
+				tickerChan <- time.Now()
+				monitor.Run()
+
+				var received *state.Message
+				Eventually(stateCh).Should(Receive(&received))
+				Expect(received.Status).To(Equal("ok"))
+			})
+
+			It("does not deliver state messages that don't match the filter", func() {
+				stateCh, cancel := monitor.Subscribe(SubscriptionFilter{Status: "critical"})
+				defer cancel()
+
+				// Stop on the second tick so the first tick's "ok" message is
+				// published while the subscription is still live.
+				loops := 0
+				monitor.MonitorFunc = func() error {
+					loops++
+					if loops >= 2 {
+						monitor.Stop()
+					}
+					return nil
+				}
+				tickerChan <- time.Now()
+				tickerChan <- time.Now()
+				monitor.Run()
+
+				Consistently(stateCh).ShouldNot(Receive())
+			})
+
+			It("fans out alerter messages matching the alerter name", func() {
+				alertCh, cancel := monitor.SubscribeAlerts(SubscriptionFilter{AlerterName: "warning_alerter"})
+				defer cancel()
+
+				var loops int = 0
+				failedCheck := func() error {
+					loops++
+					if loops >= WarningMessages+1 {
+						monitor.Stop()
+					}
+					return errors.New("Failed check")
+				}
+				for i := 0; i < WarningMessages+1; i++ {
+					tickerChan <- time.Now()
+				}
+				monitor.MonitorFunc = failedCheck
+				monitor.Run()
+
+				var received *alerter.Message
+				Eventually(alertCh).Should(Receive(&received))
+				Expect(received.Type).To(Equal("warning"))
+			})
+
+			It("stops delivering to a subscriber after it cancels", func() {
+				stateCh, cancel := monitor.Subscribe(SubscriptionFilter{})
+				cancel()
+				cancel() // must be safe to call twice
+
+				_, stillOpen := <-stateCh
+				Expect(stillOpen).To(BeFalse())
+			})
+
+			It("closes live subscriptions when the monitor is stopped", func() {
+				stateCh, _ := monitor.Subscribe(SubscriptionFilter{})
+				alertCh, _ := monitor.SubscribeAlerts(SubscriptionFilter{})
+
+				monitor.Stop()
+				Expect(monitor.Run()).To(BeNil())
+
+				_, stateOpen := <-stateCh
+				Expect(stateOpen).To(BeFalse())
+				_, alertOpen := <-alertCh
+				Expect(alertOpen).To(BeFalse())
+			})
+
+			It("counts messages dropped by a slow subscriber instead of losing them silently", func() {
+				_, cancel := monitor.Subscribe(SubscriptionFilter{})
+				defer cancel()
+
+				Expect(monitor.DroppedStateMessages()).To(Equal(uint64(0)))
+
+				// Never drain the subscriber channel: once its buffer fills,
+				// publishState must drop rather than block, and count it.
+				// RMC.StateChannel is drained alongside so publishState's own
+				// (unrelated) send to it never blocks this test.
+				go func() {
+					for range stateChan {
+					}
+				}()
+				for i := 0; i < subscriberBuffer+3; i++ {
+					monitor.publishState(&state.Message{Status: "ok"})
+				}
+
+				Expect(monitor.DroppedStateMessages()).To(Equal(uint64(3)))
+			})
+		})
+
+		Context("escalation", func() {
+			BeforeEach(func() {
+				monitor.RMC.Config.EscalationLevels = []EscalationLevel{
+					{
+						AfterConsecutiveFailures: 3,
+						Alerters:                 []string{"escalation_alerter"},
+					},
+				}
+			})
+
+			It("emits an escalate message once the consecutive-failure threshold is crossed", func() {
+				loops := 0
+				failedCheck := func() error {
+					loops++
+					if loops >= 3 {
+						monitor.Stop()
+					}
+					return errors.New("failed check")
+				}
+				for i := 0; i < 3; i++ {
+					tickerChan <- time.Now()
+				}
+				monitor.MonitorFunc = failedCheck
+				monitor.Run()
+
+				var receivedAlert *alerter.Message
+				for i := 0; i < 1+CriticalMessages; i++ { // warning + critical + escalate
+					Eventually(monitor.RMC.MessageChannel).Should(Receive(&receivedAlert))
+					if receivedAlert.Type == "escalate" {
+						break
+					}
+				}
+				Expect(receivedAlert.Type).To(Equal("escalate"))
+				Expect(receivedAlert.Key).To(Equal([]string{"escalation_alerter"}))
+				Expect(receivedAlert.Text).To(ContainSubstring("level 1"))
+			})
+
+			It("sends a single resolve even when an alerter sits at multiple tiers", func() {
+				monitor.RMC.Config.WarningAlerter = []string{"dupe_alerter"}
+				monitor.RMC.Config.CriticalAlerter = []string{"dupe_alerter"}
+				monitor.RMC.Config.EscalationLevels = []EscalationLevel{
+					{AfterConsecutiveFailures: 3, Alerters: []string{"dupe_alerter"}},
+				}
+
+				loops := 0
+				warnCritEscalateResolve := func() error {
+					loops++
+					if loops >= 4 {
+						monitor.Stop()
+					}
+					if loops <= 3 {
+						return errors.New("failed check")
+					}
+					return nil
+				}
+				for i := 0; i < 4; i++ {
+					tickerChan <- time.Now()
+				}
+				monitor.MonitorFunc = warnCritEscalateResolve
+				monitor.Run()
+
+				var resolveCount int
+				var receivedAlert *alerter.Message
+				for i := 0; i < 4; i++ {
+					Eventually(monitor.RMC.MessageChannel).Should(Receive(&receivedAlert))
+					if receivedAlert.Type == "resolve" {
+						resolveCount++
+					}
+				}
+				Expect(resolveCount).To(Equal(1))
+			})
+		})
+
+		Context("heartbeat", func() {
+			var hits []string
+			var heartbeatServer *httptest.Server
+
+			BeforeEach(func() {
+				hits = nil
+				heartbeatServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					hits = append(hits, r.URL.String())
+				}))
+
+				monitor.RMC.Config.HeartbeatURL = heartbeatServer.URL
+			})
+
+			AfterEach(func() {
+				heartbeatServer.Close()
+			})
+
+			It("pings /start then /success on a passing check", func() {
+				tickerChan <- time.Now()
+				monitor.MonitorFunc = func() error {
+					monitor.Stop()
+					return nil
+				}
+				monitor.Run()
+
+				Expect(hits).To(Equal([]string{"/start", "/success"}))
+			})
+
+			It("pings /fail with the state's exit code when HeartbeatOnStates allows it", func() {
+				monitor.RMC.Config.HeartbeatOnStates = []string{"critical"}
+
+				loops := 0
+				for i := 0; i < CriticalMessages; i++ {
+					tickerChan <- time.Now()
+				}
+				monitor.MonitorFunc = func() error {
+					loops++
+					if loops >= CriticalMessages {
+						monitor.Stop()
+					}
+					return errors.New("failed check")
+				}
+				monitor.Run()
+
+				Expect(hits).To(Equal([]string{"/start", "/start", "/fail?exit=2"}))
+			})
+
+			It("does not ping a state that's not in HeartbeatOnStates", func() {
+				monitor.RMC.Config.HeartbeatOnStates = []string{"ok"}
+
+				loops := 0
+				for i := 0; i < WarningMessages; i++ {
+					tickerChan <- time.Now()
+				}
+				monitor.MonitorFunc = func() error {
+					loops++
+					if loops >= WarningMessages {
+						monitor.Stop()
+					}
+					return errors.New("failed check")
+				}
+				monitor.Run()
+
+				Expect(hits).To(Equal([]string{"/start"}))
+			})
+
+			It("still pings /success while a failing tick hasn't yet crossed WarningThreshold", func() {
+				monitor.RMC.Config.WarningThreshold = 3
+
+				tickerChan <- time.Now()
+				monitor.MonitorFunc = func() error {
+					monitor.Stop()
+					return errors.New("failed check")
+				}
+				monitor.Run()
+
+				// One failing tick with WarningThreshold 3 isn't enough to
+				// move currentState off OK, so with the default
+				// HeartbeatOnStates (["ok"]) this must still read as a
+				// passing heartbeat, not /fail?exit=0.
+				Expect(hits).To(Equal([]string{"/start", "/success"}))
+			})
+		})
+
+		Context("session reporting", func() {
+			BeforeEach(func() {
+				monitor.RMC.SessionTicker = &time.Ticker{C: make(chan time.Time, 1)}
+				monitor.RMC.Config.WarningAlerter = []string{"session_alerter"}
+				monitor.RMC.Config.SessionAlerter = []string{"session_alerter"}
+
+				monitor.resolveMessages = make(map[string]*alerter.Message)
+				monitor.session = newSessionAccumulator()
+
+				loops := 0
+				monitor.MonitorFunc = func() error {
+					loops++
+					if loops >= WarningMessages+1 {
+						return nil
+					}
+					return errors.New("failed check")
+				}
+
+				// drive the handler directly (same pattern as the invalid
+				// transition test above) so the session flush can't race
+				// with Run()'s select over multiple channels
+				for i := 0; i < WarningMessages+1; i++ {
+					monitor.handle(monitor.MonitorFunc())
+				}
+				monitor.flushSession()
+			})
+
+			It("sends a single rolled-up report instead of per-event alerts", func() {
+				var receivedAlert *alerter.Message
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&receivedAlert))
+
+				Expect(receivedAlert.Type).To(Equal("session"))
+				Expect(receivedAlert.Key).To(Equal([]string{"session_alerter"}))
+				Expect(receivedAlert.Report).ToNot(BeNil())
+				Expect(receivedAlert.Report.ChecksRun).To(Equal(WarningMessages + 1))
+				Expect(receivedAlert.Report.ChecksFailed).To(Equal(WarningMessages))
+				Expect(receivedAlert.Report.Transitions).To(ContainElement("ok->warning"))
+			})
+
+			It("does not emit a per-event warning alert for the session alerter", func() {
+				var receivedAlert *alerter.Message
+				Eventually(monitor.RMC.MessageChannel).Should(Receive(&receivedAlert))
+				Expect(receivedAlert.Type).To(Equal("session"))
+				Consistently(monitor.RMC.MessageChannel).ShouldNot(Receive())
+			})
+		})
 	})
 })
@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/9corp/9volt/alerter"
+	"github.com/9corp/9volt/state"
+)
+
+// IMonitor is implemented by every monitor driver (http, tcp, exec, ...) so
+// the coordinator can start/stop/identify them without caring which
+// concrete check type it's holding.
+type IMonitor interface {
+	Run() error
+	Stop()
+	Identify() string
+}
+
+// Subscriber is implemented by anything that can hand out live, filtered
+// copies of a monitor's state and alert output - an HTTP SSE endpoint, a
+// websocket handler, or an in-process consumer - without racing on the
+// single-consumer StateChannel/MessageChannel.
+type Subscriber interface {
+	Subscribe(filter SubscriptionFilter) (<-chan *state.Message, CancelFunc)
+	SubscribeAlerts(filter SubscriptionFilter) (<-chan *alerter.Message, CancelFunc)
+}
+
+// CancelFunc unsubscribes a previously-registered subscription. Safe to
+// call more than once.
+type CancelFunc func()
+
+// SubscriptionFilter narrows which messages a subscriber receives; a zero
+// value field matches anything.
+type SubscriptionFilter struct {
+	Status      string // matches state.Message.Status / alerter.Message.Type
+	Check       string // matches state.Message.Check / alerter.Message.Source
+	AlerterName string // matches an entry in alerter.Message.Key; ignored for state messages
+}
+
+// RootMonitorConfig ("RMC") bundles everything a monitor driver needs that
+// isn't specific to the check itself: the ticker driving it, the channels
+// it reports through, and the config a user configured it with.
+type RootMonitorConfig struct {
+	GID            string // goroutine id
+	Name           string // monitor config name in member dir
+	ConfigName     string // monitor config name in monitor dir
+	MemberID       string
+	Config         *MonitorConfig
+	MessageChannel chan *alerter.Message
+	StateChannel   chan *state.Message
+	StopChannel    chan bool
+	Ticker         *time.Ticker
+	Log            log.FieldLogger
+
+	// SessionTicker drives the session report flush when Config.SessionInterval
+	// and Config.SessionAlerter are set; set up by whatever constructs the
+	// monitor, the same way Ticker is.
+	SessionTicker *time.Ticker
+}
+
+// MonitorConfig holds the settings a monitor driver is constructed with.
+// Only the generic/alerting bits live here; driver-specific fields (http
+// url, tcp send string, ...) belong to whichever driver needs them.
+type MonitorConfig struct {
+	Type        string        `json:"type"` // 'tcp', 'http', 'exec', ...
+	Description string        `json:"description,omitempty"`
+	Interval    time.Duration `json:"interval,omitempty"`
+	Timeout     time.Duration `json:"timeout,omitempty"`
+
+	// Alerting related configuration
+	WarningThreshold  int      `json:"warning-threshold,omitempty"`  // how many times a check must fail before a warning alert is emitted
+	CriticalThreshold int      `json:"critical-threshold,omitempty"` // how many times a check must fail before a critical alert is emitted
+	WarningAlerter    []string `json:"warning-alerter,omitempty"`    // these alerters will be contacted when a warning threshold is hit
+	CriticalAlerter   []string `json:"critical-alerter,omitempty"`   // these alerters will be contacted when a critical threshold is hit
+
+	// SessionInterval, when set, causes any alerter listed in SessionAlerter
+	// to stop receiving per-event warning/critical/resolve messages and
+	// instead receive a single rolled-up "session" message on this
+	// interval describing everything that happened since the last one.
+	SessionInterval time.Duration `json:"session-interval,omitempty"`
+	SessionAlerter  []string      `json:"session-alerter,omitempty"` // these alerters get a session report instead of per-event alerts
+
+	// FlapThreshold/FlapWindow, when both set, suppress warning/critical/
+	// resolve alerts once a check has transitioned FlapThreshold times
+	// within FlapWindow, until it's gone FlapCooldown without a further
+	// transition. FlapCooldown defaults to 5 minutes if left unset, so
+	// flapping can never become a silent, permanent alert blackhole.
+	FlapThreshold int           `json:"flap-threshold,omitempty"`
+	FlapWindow    time.Duration `json:"flap-window,omitempty"`
+	FlapCooldown  time.Duration `json:"flap-cooldown,omitempty"`
+
+	// HeartbeatURL, when set, causes the monitor to push liveness pings to
+	// an external dead-man service (eg. Healthchecks.io, Uptime Kuma):
+	// HeartbeatURL+"/start" before running the check, then +"/success" or
+	// +"/fail?exit=N" after, so the service pages if 9volt itself stops
+	// making progress. HeartbeatOnStates restricts which resulting check
+	// states actually get pinged (defaulting to just "ok") so an operator
+	// can choose to stop heartbeating once a check is genuinely broken.
+	HeartbeatURL      string        `json:"heartbeat-url,omitempty"`
+	HeartbeatOnStates []string      `json:"heartbeat-on-states,omitempty"`
+	HeartbeatTimeout  time.Duration `json:"heartbeat-timeout,omitempty"`
+
+	// EscalationLevels lets an operator be paged progressively the longer a
+	// check stays broken, on top of the plain WarningAlerter/CriticalAlerter.
+	// Levels are evaluated in order and, once fired, stay fired until the
+	// check resolves.
+	EscalationLevels []EscalationLevel `json:"escalation-levels,omitempty"`
+
+	// MaxCheckDuration/MaxTickerSilence arm a watchdog that raises a
+	// "stale" alert if MonitorFunc hasn't returned, or the ticker hasn't
+	// advanced, within the given duration - catching a stalled monitor
+	// even when the check function itself can't report warning/critical
+	// because it's the thing that's stuck.
+	MaxCheckDuration time.Duration `json:"max-check-duration,omitempty"`
+	MaxTickerSilence time.Duration `json:"max-ticker-silence,omitempty"`
+}
+
+// EscalationLevel describes one rung of an escalation ladder: once a check
+// has been failing for AfterConsecutiveFailures attempts or AfterDuration
+// (whichever is set and reached first), Alerters are sent an "escalate"
+// alerter.Message.
+type EscalationLevel struct {
+	AfterConsecutiveFailures int           `json:"after-consecutive-failures,omitempty"`
+	AfterDuration            time.Duration `json:"after-duration,omitempty"`
+	Alerters                 []string      `json:"alerters,omitempty"`
+}
@@ -0,0 +1,22 @@
+// Package state carries point-in-time check results from a monitor to
+// whatever is responsible for persisting/broadcasting cluster state.
+package state
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Message represents a single state update emitted by a monitor each time
+// its ticker fires. It is intentionally decoupled from alerter.Message:
+// state updates are fired on every check, alerts only on transitions and
+// other alert-worthy events (escalations, session reports, staleness).
+type Message struct {
+	Check   string          `json:"check"`
+	Owner   string          `json:"owner"`
+	Status  string          `json:"status"`
+	Count   int             `json:"count"`
+	Message string          `json:"message"`
+	Date    time.Time       `json:"date"`
+	Config  json.RawMessage `json:"config"`
+}